@@ -0,0 +1,45 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import ct "github.com/google/certificate-transparency-go"
+
+// chunk is a contiguous, already-fetched run of leaves starting at
+// startIndex, produced by a single fetch worker. Chunks are reassembled
+// into index order by a chunkHeap before they're fed to the compact range
+// and the matcher.
+type chunk struct {
+	startIndex uint64
+	entries    []*ct.LogEntry
+	leafHashes [][]byte
+	err        error
+}
+
+// chunkHeap is a container/heap.Interface over chunks, ordered by
+// startIndex, so the lowest not-yet-consumed chunk is always at the root.
+type chunkHeap []*chunk
+
+func (h chunkHeap) Len() int            { return len(h) }
+func (h chunkHeap) Less(i, j int) bool  { return h[i].startIndex < h[j].startIndex }
+func (h chunkHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x interface{}) { *h = append(*h, x.(*chunk)) }
+func (h *chunkHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return c
+}
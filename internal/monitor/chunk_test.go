@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"container/heap"
+	"testing"
+)
+
+func TestChunkHeapOrdersByStartIndex(t *testing.T) {
+	h := &chunkHeap{}
+	heap.Init(h)
+
+	// Push out of order, as concurrent fetch workers would complete out of
+	// order, and check they come back out sorted by startIndex.
+	starts := []uint64{3000, 0, 2000, 1000}
+	for _, s := range starts {
+		heap.Push(h, &chunk{startIndex: s})
+	}
+
+	var got []uint64
+	for h.Len() > 0 {
+		got = append(got, heap.Pop(h).(*chunk).startIndex)
+	}
+	want := []uint64{0, 1000, 2000, 3000}
+	if len(got) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("order[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestChunkHeapPeekOnlyAdvancesOnContiguousRun(t *testing.T) {
+	// Mirrors how Scan consumes the heap: only pop while the root is
+	// exactly the next expected index, so a gap (a chunk that hasn't
+	// arrived yet) correctly stalls consumption instead of skipping ahead.
+	h := &chunkHeap{}
+	heap.Init(h)
+	heap.Push(h, &chunk{startIndex: 0, leafHashes: [][]byte{{1}}})
+	heap.Push(h, &chunk{startIndex: 2, leafHashes: [][]byte{{1}}})
+
+	next := uint64(0)
+	var consumed []uint64
+	for h.Len() > 0 && (*h)[0].startIndex == next {
+		c := heap.Pop(h).(*chunk)
+		consumed = append(consumed, c.startIndex)
+		next += uint64(len(c.leafHashes))
+	}
+	if len(consumed) != 1 || consumed[0] != 0 {
+		t.Fatalf("consumed = %v, want only chunk at index 0 (gap at 1 should stall)", consumed)
+	}
+	if h.Len() != 1 {
+		t.Fatalf("heap.Len() = %d, want 1 (chunk at index 2 still pending)", h.Len())
+	}
+}
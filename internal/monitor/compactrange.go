@@ -0,0 +1,74 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import "github.com/transparency-dev/merkle/rfc6962"
+
+// frontierNode is one perfect subtree on a CompactRange's frontier.
+type frontierNode struct {
+	level int
+	hash  []byte
+}
+
+// CompactRange incrementally builds up the RFC 6962 Merkle tree hash of a
+// (possibly still-growing) log as leaves are appended to it one at a time,
+// without needing to hold every leaf hash in memory at once. It lets the
+// monitor verify a newly-fetched batch of entries terminates at a log's
+// published root without re-fetching or re-hashing everything that came
+// before.
+type CompactRange struct {
+	size     uint64
+	frontier []frontierNode
+}
+
+// NewCompactRange returns an empty CompactRange.
+func NewCompactRange() *CompactRange {
+	return &CompactRange{}
+}
+
+// Size returns the number of leaves appended so far.
+func (c *CompactRange) Size() uint64 {
+	return c.size
+}
+
+// Append extends the range with one more leaf hash.
+func (c *CompactRange) Append(leafHash []byte) {
+	c.frontier = append(c.frontier, frontierNode{level: 0, hash: leafHash})
+	c.size++
+	// The number of merges to perform is the number of trailing 0 bits in
+	// the new size: that's how many same-sized perfect subtrees are
+	// currently sitting at the top of the frontier.
+	for v := c.size; v&1 == 0; v >>= 1 {
+		n := len(c.frontier)
+		right, left := c.frontier[n-1], c.frontier[n-2]
+		parent := frontierNode{
+			level: left.level + 1,
+			hash:  rfc6962.DefaultHasher.HashChildren(left.hash, right.hash),
+		}
+		c.frontier = append(c.frontier[:n-2], parent)
+	}
+}
+
+// Root returns the Merkle tree hash of every leaf appended so far.
+func (c *CompactRange) Root() []byte {
+	if len(c.frontier) == 0 {
+		return rfc6962.DefaultHasher.EmptyRoot()
+	}
+	hash := c.frontier[len(c.frontier)-1].hash
+	for i := len(c.frontier) - 2; i >= 0; i-- {
+		hash = rfc6962.DefaultHasher.HashChildren(c.frontier[i].hash, hash)
+	}
+	return hash
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// mthRef computes the RFC 6962 Merkle tree hash of leaves directly from the
+// recursive definition, as a reference to check CompactRange's incremental
+// frontier-merge arithmetic against.
+func mthRef(leaves [][]byte) []byte {
+	n := len(leaves)
+	if n == 0 {
+		return rfc6962.DefaultHasher.EmptyRoot()
+	}
+	if n == 1 {
+		return leaves[0]
+	}
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return rfc6962.DefaultHasher.HashChildren(mthRef(leaves[:k]), mthRef(leaves[k:]))
+}
+
+func leafHashes(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		h := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+		out[i] = h[:]
+	}
+	return out
+}
+
+func TestCompactRangeMatchesReferenceMTH(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 5, 7, 8, 15, 16, 17, 32, 100} {
+		leaves := leafHashes(n)
+		cr := NewCompactRange()
+		for _, h := range leaves {
+			cr.Append(h)
+		}
+		if got, want := cr.Size(), uint64(n); got != want {
+			t.Errorf("size %d: Size() = %d, want %d", n, got, want)
+		}
+		if got, want := cr.Root(), mthRef(leaves); !bytes.Equal(got, want) {
+			t.Errorf("size %d: Root() = %x, want %x", n, got, want)
+		}
+	}
+}
+
+func TestCompactRangeEmptyRoot(t *testing.T) {
+	cr := NewCompactRange()
+	if got, want := cr.Root(), rfc6962.DefaultHasher.EmptyRoot(); !bytes.Equal(got, want) {
+		t.Errorf("Root() of empty range = %x, want %x", got, want)
+	}
+}
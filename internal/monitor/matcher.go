@@ -0,0 +1,101 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// DNSNameMatcher matches entries whose leaf certificate has a SAN or CN
+// matching the given regexp.
+type DNSNameMatcher struct {
+	Pattern *regexp.Regexp
+}
+
+// Match implements Matcher.
+func (m DNSNameMatcher) Match(entry *ct.LogEntry) (bool, string) {
+	cert := leafCertificate(entry)
+	if cert == nil {
+		return false, ""
+	}
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, n := range names {
+		if m.Pattern.MatchString(n) {
+			return true, n
+		}
+	}
+	return false, ""
+}
+
+// IssuerMatcher matches entries whose leaf certificate was issued by a
+// distinguished name matching the given regexp.
+type IssuerMatcher struct {
+	Pattern *regexp.Regexp
+}
+
+// Match implements Matcher.
+func (m IssuerMatcher) Match(entry *ct.LogEntry) (bool, string) {
+	cert := leafCertificate(entry)
+	if cert == nil {
+		return false, ""
+	}
+	dn := cert.Issuer.String()
+	if m.Pattern.MatchString(dn) {
+		return true, dn
+	}
+	return false, ""
+}
+
+// SPKIHashMatcher matches entries whose leaf certificate's SHA-256
+// subject-public-key-info hash is in the given set.
+type SPKIHashMatcher struct {
+	Hashes map[[32]byte]bool
+}
+
+// Match implements Matcher.
+func (m SPKIHashMatcher) Match(entry *ct.LogEntry) (bool, string) {
+	cert := leafCertificate(entry)
+	if cert == nil {
+		return false, ""
+	}
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	if m.Hashes[h] {
+		return true, fmt.Sprintf("spki:%x", h)
+	}
+	return false, ""
+}
+
+// leafCertificate extracts the parsed leaf certificate from a log entry,
+// whether it came from an X.509 chain or a precertificate, returning nil if
+// it could not be parsed. Precertificates make up a large share of real
+// log traffic, so a matcher that only looked at X509Cert would silently
+// never match most of it.
+func leafCertificate(entry *ct.LogEntry) *x509.Certificate {
+	if entry == nil {
+		return nil
+	}
+	if entry.X509Cert != nil {
+		return entry.X509Cert
+	}
+	if entry.Precert != nil {
+		return entry.Precert.TBSCertificate
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package monitor implements continuous, proof-verified certificate
+// monitoring across multiple CT logs. A caller (typically a feeder that has
+// just advanced a log's witnessed STH) passes a Scanner a Job describing a
+// new range of entries to scan; the Scanner fetches that range in parallel,
+// reassembles it in strict index order, verifies it against the log's
+// Merkle tree, and runs every entry through a pluggable Matcher.
+package monitor
+
+import (
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// Job describes a half-open range of leaf indices, [Start, End), that has
+// become available to scan for a given log.
+type Job struct {
+	LogID string
+	Start uint64
+	End   uint64
+}
+
+// Matcher decides whether a log entry is of interest.
+type Matcher interface {
+	// Match reports whether entry matches, and if so a short human-readable
+	// reason (e.g. the SAN that matched).
+	Match(entry *ct.LogEntry) (matched bool, reason string)
+}
+
+// Sink receives entries that matched while scanning a log.
+type Sink interface {
+	// Write records that entry (found at index in logID, with the given
+	// Merkle leaf hash) matched, for the reason given by the Matcher.
+	Write(logID string, index uint64, leafHash []byte, entry *ct.LogEntry, reason string) error
+}
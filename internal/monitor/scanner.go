@@ -0,0 +1,177 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// Scanner fetches a range of entries from a single log, in parallel, and
+// reassembles them in order to feed a Matcher and a growing CompactRange.
+type Scanner struct {
+	// Client talks to the log being scanned.
+	Client *client.LogClient
+	// Matcher decides which entries are of interest. May be nil, in which
+	// case no entry ever matches.
+	Matcher Matcher
+	// Sink receives matching entries. May be nil if Matcher is nil.
+	Sink Sink
+	// BatchSize is the number of entries requested per get-entries call.
+	BatchSize uint64
+	// Concurrency is the number of batches fetched in parallel.
+	Concurrency int
+}
+
+// Scan fetches job.Start..job.End from the log, in parallel batches of
+// BatchSize, and appends each leaf hash (in strict index order) to prior,
+// which may be nil to start a fresh range. Every entry is also passed to
+// Matcher, and matches are written to Sink. If the range reaches
+// sth.TreeSize, the resulting root is checked against sth and an error is
+// returned if it doesn't match.
+func (s *Scanner) Scan(ctx context.Context, job Job, sth *ct.SignedTreeHead, prior *CompactRange) (*CompactRange, error) {
+	if job.End <= job.Start {
+		return prior, nil
+	}
+	cr := prior
+	if cr == nil {
+		cr = NewCompactRange()
+	}
+	if cr.Size() != job.Start {
+		return nil, fmt.Errorf("compact range at size %d does not match job start %d", cr.Size(), job.Start)
+	}
+
+	batchSize := s.BatchSize
+	if batchSize == 0 {
+		batchSize = 1000
+	}
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type batch struct{ start, end uint64 }
+	var batches []batch
+	for start := job.Start; start < job.End; start += batchSize {
+		end := start + batchSize
+		if end > job.End {
+			end = job.End
+		}
+		batches = append(batches, batch{start, end})
+	}
+
+	work := make(chan batch)
+	results := make(chan *chunk, len(batches))
+	errCh := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for b := range work {
+				results <- s.fetchChunk(ctx, b.start, b.end)
+			}
+		}()
+	}
+	go func() {
+		defer close(work)
+		for _, b := range batches {
+			select {
+			case work <- b:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	// Reassemble chunks in strict index order via a min-heap: a worker may
+	// finish batch 3 before batch 1, but we must feed the compact range
+	// (and the matcher) leaves in order.
+	h := &chunkHeap{}
+	heap.Init(h)
+	next := job.Start
+	received := uint64(0)
+	total := job.End - job.Start
+	for received < total {
+		var c *chunk
+		select {
+		case err := <-errCh:
+			return nil, fmt.Errorf("scan of %s cancelled while dispatching: %v", job.LogID, err)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case c = <-results:
+		}
+		if c.err != nil {
+			return nil, fmt.Errorf("failed to fetch entries starting at %d: %v", c.startIndex, c.err)
+		}
+		heap.Push(h, c)
+		for h.Len() > 0 && (*h)[0].startIndex == next {
+			c := heap.Pop(h).(*chunk)
+			for i, leafHash := range c.leafHashes {
+				cr.Append(leafHash)
+				if s.Matcher != nil {
+					if matched, reason := s.Matcher.Match(c.entries[i]); matched {
+						idx := c.startIndex + uint64(i)
+						if err := s.Sink.Write(job.LogID, idx, leafHash, c.entries[i], reason); err != nil {
+							return nil, fmt.Errorf("failed to write match at index %d: %v", idx, err)
+						}
+					}
+				}
+			}
+			next += uint64(len(c.leafHashes))
+			received += uint64(len(c.leafHashes))
+		}
+	}
+
+	if cr.Size() == sth.TreeSize {
+		if !bytes.Equal(cr.Root(), sth.SHA256RootHash[:]) {
+			return nil, fmt.Errorf("computed root at size %d does not match STH root", cr.Size())
+		}
+	}
+	return cr, nil
+}
+
+// fetchChunk fetches and parses a single batch of entries, spanning
+// [start, end). CT logs are permitted by RFC 6962 to return fewer entries
+// than requested from a single get-entries call, so this keeps re-issuing
+// the request for whatever remains of the range until it's fully filled.
+func (s *Scanner) fetchChunk(ctx context.Context, start, end uint64) *chunk {
+	c := &chunk{startIndex: start}
+	for cur := start; cur < end; {
+		entries, err := s.Client.GetEntries(ctx, int64(cur), int64(end)-1)
+		if err != nil {
+			return &chunk{startIndex: start, err: fmt.Errorf("get-entries(%d, %d) failed: %v", cur, end-1, err)}
+		}
+		if len(entries) == 0 {
+			return &chunk{startIndex: start, err: fmt.Errorf("get-entries(%d, %d) returned no entries", cur, end-1)}
+		}
+		for i := range entries {
+			e := &entries[i]
+			leafBytes, err := tls.Marshal(e.Leaf)
+			if err != nil {
+				return &chunk{startIndex: start, err: fmt.Errorf("failed to marshal leaf at index %d: %v", cur+uint64(i), err)}
+			}
+			c.entries = append(c.entries, e)
+			c.leafHashes = append(c.leafHashes, rfc6962.DefaultHasher.HashLeaf(leafBytes))
+		}
+		cur += uint64(len(entries))
+	}
+	return c
+}
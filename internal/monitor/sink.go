@@ -0,0 +1,111 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// matchRecord is the JSONL record written for every matching entry.
+type matchRecord struct {
+	LogID    string `json:"log_id"`
+	Index    uint64 `json:"index"`
+	Reason   string `json:"reason"`
+	LeafHash string `json:"leaf_hash"`
+}
+
+// jsonlSink writes matches as newline-delimited JSON to a single writer,
+// serializing concurrent writes from multiple scanners.
+type jsonlSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutSink returns a Sink that writes matches as JSONL to stdout.
+func NewStdoutSink() Sink {
+	return &jsonlSink{w: os.Stdout}
+}
+
+// Write implements Sink.
+func (s *jsonlSink) Write(logID string, index uint64, leafHash []byte, entry *ct.LogEntry, reason string) error {
+	rec := matchRecord{
+		LogID:    logID,
+		Index:    index,
+		Reason:   reason,
+		LeafHash: hex.EncodeToString(leafHash),
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal match record: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.w, "%s\n", b)
+	return err
+}
+
+// fileSink writes matches as JSONL to one file per log, under dir.
+type fileSink struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewFileSink returns a Sink that appends matches to "<dir>/<logID>.jsonl"
+// (with logID escaped so it's safe to use as a path component), creating
+// the directory if necessary.
+func NewFileSink(dir string) (Sink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sink directory: %v", err)
+	}
+	return &fileSink{dir: dir, files: map[string]*os.File{}}, nil
+}
+
+// Write implements Sink.
+func (s *fileSink) Write(logID string, index uint64, leafHash []byte, entry *ct.LogEntry, reason string) error {
+	rec := matchRecord{
+		LogID:    logID,
+		Index:    index,
+		Reason:   reason,
+		LeafHash: hex.EncodeToString(leafHash),
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal match record: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[logID]
+	if !ok {
+		f, err = os.OpenFile(filepath.Join(s.dir, url.PathEscape(logID)+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open sink file for %s: %v", logID, err)
+		}
+		s.files[logID] = f
+	}
+	_, err = fmt.Fprintf(f, "%s\n", b)
+	return err
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive provides a durable, append-only on-disk record of the
+// STHs a feeder has successfully pushed to a witness, along with the
+// consistency proofs chaining them together. It lets a feeder resume from
+// its last known state after a restart, and lets an operator audit a
+// log's witnessed history offline.
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+const latestLink = "latest"
+
+var sthFileRE = regexp.MustCompile(`^sth-(\d+)\.json$`)
+
+// Entry is a single archived STH, together with the consistency proof that
+// chains it to the previously archived STH (empty if this is the first
+// entry for the log).
+type Entry struct {
+	STH   *ct.SignedTreeHead
+	Proof [][]byte
+}
+
+// logDir returns the directory under stateDir used to store entries for
+// logID, escaping it so it is safe to use as a path component.
+func logDir(stateDir, logID string) string {
+	return filepath.Join(stateDir, url.PathEscape(logID))
+}
+
+// Append durably records a new STH for logID, along with the consistency
+// proof from fromSize to sth.TreeSize (which should be empty if fromSize is
+// zero), and advances the "latest" marker to point at it.
+func Append(stateDir, logID string, sth *ct.SignedTreeHead, sthRaw []byte, proof [][]byte, fromSize uint64) error {
+	dir := logDir(stateDir, logID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %v", err)
+	}
+
+	sthName := fmt.Sprintf("sth-%d.json", sth.TreeSize)
+	if err := ioutil.WriteFile(filepath.Join(dir, sthName), sthRaw, 0644); err != nil {
+		return fmt.Errorf("failed to write archived STH: %v", err)
+	}
+
+	if len(proof) > 0 {
+		proofName := fmt.Sprintf("proof-%d-%d.json", fromSize, sth.TreeSize)
+		b, err := json.Marshal(proof)
+		if err != nil {
+			return fmt.Errorf("failed to marshal consistency proof: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, proofName), b, 0644); err != nil {
+			return fmt.Errorf("failed to write archived consistency proof: %v", err)
+		}
+	}
+
+	link := filepath.Join(dir, latestLink)
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(sthName, tmp); err != nil {
+		return fmt.Errorf("failed to create latest symlink: %v", err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		return fmt.Errorf("failed to install latest symlink: %v", err)
+	}
+	return nil
+}
+
+// Latest returns the most recently archived STH for logID, and the raw
+// bytes it was stored as. It returns a nil STH, rather than an error, if
+// nothing has been archived for logID yet.
+func Latest(stateDir, logID string) (*ct.SignedTreeHead, []byte, error) {
+	dir := logDir(stateDir, logID)
+	target, err := os.Readlink(filepath.Join(dir, latestLink))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to read latest symlink: %v", err)
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, target))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read archived STH: %v", err)
+	}
+	var sthJSON ct.GetSTHResponse
+	if err := json.Unmarshal(raw, &sthJSON); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal archived STH: %v", err)
+	}
+	sth, err := sthJSON.ToSignedTreeHead()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse archived STH: %v", err)
+	}
+	return sth, raw, nil
+}
+
+// Range returns the consistency proof previously archived between fromSize
+// and toSize for logID.
+func Range(stateDir, logID string, fromSize, toSize uint64) ([][]byte, error) {
+	path := filepath.Join(logDir(stateDir, logID), fmt.Sprintf("proof-%d-%d.json", fromSize, toSize))
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived consistency proof: %v", err)
+	}
+	var proof [][]byte
+	if err := json.Unmarshal(b, &proof); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal archived consistency proof: %v", err)
+	}
+	return proof, nil
+}
+
+// Sizes returns the tree sizes of every STH archived for logID, sorted in
+// ascending order.
+func Sizes(stateDir, logID string) ([]uint64, error) {
+	dir := logDir(stateDir, logID)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list archive directory: %v", err)
+	}
+	var sizes []uint64
+	for _, f := range files {
+		m := sthFileRE.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		size, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	return sizes, nil
+}
+
+// At returns the archived entry for logID at the given tree size, along
+// with the consistency proof from the previous archived size (fromSize).
+// fromSize is zero for the first archived entry.
+func At(stateDir, logID string, size, fromSize uint64) (Entry, error) {
+	dir := logDir(stateDir, logID)
+	raw, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("sth-%d.json", size)))
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to read archived STH: %v", err)
+	}
+	var sthJSON ct.GetSTHResponse
+	if err := json.Unmarshal(raw, &sthJSON); err != nil {
+		return Entry{}, fmt.Errorf("failed to unmarshal archived STH: %v", err)
+	}
+	sth, err := sthJSON.ToSignedTreeHead()
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to parse archived STH: %v", err)
+	}
+	var proof [][]byte
+	if fromSize > 0 {
+		proof, err = Range(stateDir, logID, fromSize, size)
+		if err != nil {
+			return Entry{}, err
+		}
+	}
+	return Entry{STH: sth, Proof: proof}, nil
+}
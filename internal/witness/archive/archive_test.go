@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// fakeSTHRaw builds the raw bytes of a get-sth response (RFC 6962 section
+// 4.3) for treeSize, with an otherwise-arbitrary but well-formed
+// tree_head_signature, so Latest/At can successfully parse it back into a
+// ct.SignedTreeHead.
+func fakeSTHRaw(treeSize, timestamp uint64, rootByte byte) []byte {
+	root := make([]byte, 32)
+	root[0] = rootByte
+
+	// A minimal, well-formed TLS DigitallySigned (RFC 5246 7.4.1.4.1):
+	// one byte each for hash and signature algorithm, a 2-byte big-endian
+	// length prefix, then the signature bytes themselves.
+	sig := []byte{0x04, 0x01, 0x00, 0x04, 0xAA, 0xBB, 0xCC, 0xDD}
+
+	return []byte(fmt.Sprintf(
+		`{"tree_size":%d,"timestamp":%d,"sha256_root_hash":%q,"tree_head_signature":%q}`,
+		treeSize, timestamp, base64.StdEncoding.EncodeToString(root), base64.StdEncoding.EncodeToString(sig),
+	))
+}
+
+func TestAppendAndLatestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	const logID = "log/with-a-slash="
+
+	if _, _, err := Latest(dir, logID); err != nil {
+		t.Fatalf("Latest on empty archive: %v", err)
+	}
+
+	raw1 := fakeSTHRaw(100, 1000, 0x01)
+	if err := Append(dir, logID, &ct.SignedTreeHead{TreeSize: 100}, raw1, nil, 0); err != nil {
+		t.Fatalf("Append(100): %v", err)
+	}
+	sth, raw, err := Latest(dir, logID)
+	if err != nil {
+		t.Fatalf("Latest after first append: %v", err)
+	}
+	if sth.TreeSize != 100 {
+		t.Errorf("Latest TreeSize = %d, want 100", sth.TreeSize)
+	}
+	if string(raw) != string(raw1) {
+		t.Errorf("Latest raw bytes = %q, want %q", raw, raw1)
+	}
+
+	proof := [][]byte{{0x01, 0x02}, {0x03, 0x04}}
+	raw2 := fakeSTHRaw(200, 2000, 0x02)
+	if err := Append(dir, logID, &ct.SignedTreeHead{TreeSize: 200}, raw2, proof, 100); err != nil {
+		t.Fatalf("Append(200): %v", err)
+	}
+	sth, _, err = Latest(dir, logID)
+	if err != nil {
+		t.Fatalf("Latest after second append: %v", err)
+	}
+	if sth.TreeSize != 200 {
+		t.Errorf("Latest TreeSize = %d, want 200 (latest symlink should have advanced)", sth.TreeSize)
+	}
+
+	gotProof, err := Range(dir, logID, 100, 200)
+	if err != nil {
+		t.Fatalf("Range(100, 200): %v", err)
+	}
+	if len(gotProof) != len(proof) {
+		t.Fatalf("Range returned %d entries, want %d", len(gotProof), len(proof))
+	}
+	for i := range proof {
+		if string(gotProof[i]) != string(proof[i]) {
+			t.Errorf("Range proof[%d] = %x, want %x", i, gotProof[i], proof[i])
+		}
+	}
+}
+
+func TestSizesReturnsSortedArchivedSizes(t *testing.T) {
+	dir := t.TempDir()
+	const logID = "another/log+id"
+
+	sizes, err := Sizes(dir, logID)
+	if err != nil {
+		t.Fatalf("Sizes on empty archive: %v", err)
+	}
+	if len(sizes) != 0 {
+		t.Fatalf("Sizes on empty archive = %v, want empty", sizes)
+	}
+
+	for _, size := range []uint64{300, 100, 200} {
+		if err := Append(dir, logID, &ct.SignedTreeHead{TreeSize: size}, fakeSTHRaw(size, size*10, byte(size)), nil, 0); err != nil {
+			t.Fatalf("Append(%d): %v", size, err)
+		}
+	}
+
+	sizes, err = Sizes(dir, logID)
+	if err != nil {
+		t.Fatalf("Sizes: %v", err)
+	}
+	want := []uint64{100, 200, 300}
+	if len(sizes) != len(want) {
+		t.Fatalf("Sizes = %v, want %v", sizes, want)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Errorf("Sizes[%d] = %d, want %d", i, sizes[i], want[i])
+		}
+	}
+}
+
+func TestLogDirEscapesLogID(t *testing.T) {
+	got := logDir("/state", "a/b")
+	want := "/state/a%2Fb"
+	if got != want {
+		t.Errorf("logDir(%q) = %q, want %q", "a/b", got, want)
+	}
+}
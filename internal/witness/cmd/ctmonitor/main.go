@@ -0,0 +1,174 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// ctmonitor piggy-backs on the same witness-quorum feed used by the feeder:
+// for each log, as the feed advances the quorum-witnessed tree size, it
+// scans the newly-witnessed entries, verifies them against the log's
+// Merkle tree, and matches them against a configured Matcher. Unlike a
+// monitor that polls a log's own self-reported STH directly, every entry
+// ctmonitor scans has already been cosigned by a quorum of witnesses, so a
+// log that tries to present different views to different clients (or roll
+// back) can't also slip unwitnessed entries past ctmonitor's matching.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/internal/monitor"
+	wh "github.com/google/certificate-transparency-go/internal/witness/client/http"
+	"github.com/google/certificate-transparency-go/internal/witness/feed"
+)
+
+var (
+	logList      = flag.String("log_list_url", "https://www.gstatic.com/ct/log_list/v3/log_list.json", "The location of the log list")
+	witnessURLs  feed.WitnessURLList
+	interval     = flag.Duration("poll", 10*time.Second, "How often to poll each log for a new STH")
+	quorumK      = flag.Int("quorum_k", 1, "Minimum number of distinct witnesses that must cosign an STH before it is treated as witnessed")
+	quorumPolicy = flag.String("quorum_policy", "", "Optional path to a JSON file mapping log ID to a per-log quorum_k override")
+	batchSize    = flag.Uint64("batch_size", 1000, "Number of entries requested per get-entries call")
+	concurrency  = flag.Int("concurrency", 4, "Number of get-entries batches fetched in parallel per log")
+	sanPattern   = flag.String("san_regexp", "", "If set, report entries whose SAN or CN matches this regexp")
+	outDir       = flag.String("out_dir", "", "If set, write one JSONL file of matches per log under this directory; otherwise matches are written to stdout")
+	statusAddr   = flag.String("status_addr", "", "If set, serve per-log feed health as JSON on /status, and Prometheus metrics on /metrics, on this address")
+)
+
+func init() {
+	flag.Var(&witnessURLs, "witness_url", "The endpoint of a witness HTTP API; may be repeated to fan out to multiple witnesses")
+}
+
+// scanState is the monitor state accumulated for a single log across
+// advances of its witnessed size.
+type scanState struct {
+	mu      sync.Mutex
+	scanned uint64
+	compact *monitor.CompactRange
+}
+
+func main() {
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(witnessURLs) == 0 {
+		glog.Exit("At least one -witness_url must be provided")
+	}
+	witnesses := make([]*wh.Witness, 0, len(witnessURLs))
+	for _, raw := range witnessURLs {
+		wURL, err := url.Parse(raw)
+		if err != nil {
+			glog.Exitf("Failed to parse witness URL %q: %v", raw, err)
+		}
+		witnesses = append(witnesses, &wh.Witness{URL: wURL})
+	}
+
+	policy, err := feed.LoadQuorumPolicy(*quorumPolicy)
+	if err != nil {
+		glog.Exitf("Failed to load quorum policy: %v", err)
+	}
+
+	var matcher monitor.Matcher
+	if *sanPattern != "" {
+		re, err := regexp.Compile(*sanPattern)
+		if err != nil {
+			glog.Exitf("Invalid -san_regexp: %v", err)
+		}
+		matcher = monitor.DNSNameMatcher{Pattern: re}
+	}
+
+	sink := monitor.NewStdoutSink()
+	if *outDir != "" {
+		var err error
+		sink, err = monitor.NewFileSink(*outDir)
+		if err != nil {
+			glog.Exitf("Failed to create sink: %v", err)
+		}
+	}
+
+	logs, err := feed.PopulateLogs(*logList)
+	if err != nil {
+		glog.Exitf("Failed to set up log data: %v", err)
+	}
+
+	if *statusAddr != "" {
+		go feed.ServeStatus(*statusAddr, logs)
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, l := range logs {
+		scanner := &monitor.Scanner{
+			Client:      l.Client,
+			Matcher:     matcher,
+			Sink:        sink,
+			BatchSize:   *batchSize,
+			Concurrency: *concurrency,
+		}
+		state := &scanState{}
+		k := *quorumK
+		if override, ok := policy[l.ID]; ok {
+			k = override
+		}
+		opts := feed.Opts{
+			Interval: *interval,
+			QuorumK:  k,
+			OnAdvance: func(logID, name string, prevSize uint64, sth *ct.SignedTreeHead) error {
+				return scanAdvance(ctx, logID, name, scanner, state, sth)
+			},
+		}
+		wg.Add(1)
+		go func(l *feed.Log) {
+			defer wg.Done()
+			if err := l.Feed(ctx, witnesses, opts); err != nil {
+				glog.Errorf("feed for %s: %v", l.Name, err)
+			}
+		}(l)
+	}
+	wg.Wait()
+}
+
+// scanAdvance scans every entry newly covered by sth - that is, from
+// state's last scanned index up to sth.TreeSize - now that the feed has
+// established (by quorum) that sth is genuinely the log's current tree
+// head. It's called synchronously from within Log.Feed's OnAdvance hook,
+// so returning an error here makes Feed treat the round as failed and
+// back off, same as any other feedOnce failure.
+func scanAdvance(ctx context.Context, logID, name string, scanner *monitor.Scanner, state *scanState, sth *ct.SignedTreeHead) error {
+	state.mu.Lock()
+	from := state.scanned
+	compact := state.compact
+	state.mu.Unlock()
+
+	if sth.TreeSize <= from {
+		return nil
+	}
+
+	job := monitor.Job{LogID: logID, Start: from, End: sth.TreeSize}
+	glog.Infof("%s: scanning witnessed entries [%d, %d)", name, job.Start, job.End)
+	newCompact, err := scanner.Scan(ctx, job, sth, compact)
+	if err != nil {
+		return fmt.Errorf("failed to scan witnessed entries [%d, %d): %v", job.Start, job.End, err)
+	}
+
+	state.mu.Lock()
+	state.scanned = sth.TreeSize
+	state.compact = newCompact
+	state.mu.Unlock()
+	return nil
+}
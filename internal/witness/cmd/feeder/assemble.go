@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// runAssemble implements the "assemble" subcommand: it hashes every file
+// collected under dir into a manifest, then packs the whole directory into
+// a single gzipped tarball that can be re-verified offline.
+func runAssemble(args []string) error {
+	fs := flag.NewFlagSet("assemble", flag.ExitOnError)
+	dir := fs.String("dir", "", "Bundle directory produced by snapshot/collect")
+	out := fs.String("out", "", "Output tarball path (default: <dir>.tar.gz)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("-dir is required")
+	}
+	outPath := *out
+	if outPath == "" {
+		outPath = filepath.Clean(*dir) + ".tar.gz"
+	}
+
+	if err := writeManifest(*dir); err != nil {
+		return fmt.Errorf("failed to build manifest: %v", err)
+	}
+	if err := tarDirectory(*dir, outPath); err != nil {
+		return fmt.Errorf("failed to assemble tarball: %v", err)
+	}
+	glog.Infof("Assembled bundle %s from %s", outPath, *dir)
+	return nil
+}
+
+// tarDirectory writes every regular file under dir into a gzipped tarball
+// at outPath, with paths relative to dir.
+func tarDirectory(dir, outPath string) error {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(tw, in)
+		return err
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Manifest lists the SHA-256 hash of every file in an evidence bundle, so
+// that the bundle can be re-verified after being moved, copied or
+// unpacked from its tarball.
+type Manifest struct {
+	// Files maps a path relative to the bundle root to the hex-encoded
+	// SHA-256 of its contents.
+	Files map[string]string `json:"files"`
+}
+
+const manifestName = "manifest.json"
+
+// sthPath returns the path, relative to a bundle directory, of the pinned
+// STH for logID. logID is escaped, as it's a base64 string and routinely
+// contains '/'.
+func sthPath(logID string) string {
+	return filepath.Join("logs", url.PathEscape(logID), "sth.json")
+}
+
+// entryPath returns the path, relative to a bundle directory, of the DER
+// for the leaf certificate at index in logID.
+func entryPath(logID string, index uint64) string {
+	return filepath.Join("logs", url.PathEscape(logID), "entries", fmt.Sprintf("%d.der", index))
+}
+
+// proofPath returns the path, relative to a bundle directory, of the
+// inclusion proof for the leaf at index in logID.
+func proofPath(logID string, index uint64) string {
+	return filepath.Join("logs", url.PathEscape(logID), "proofs", fmt.Sprintf("%d.json", index))
+}
+
+// inclusionProof is the on-disk form of an inclusion proof for a single
+// leaf, verifiable against the pinned STH for the same log.
+type inclusionProof struct {
+	LeafIndex uint64   `json:"leaf_index"`
+	TreeSize  uint64   `json:"tree_size"`
+	LeafHash  []byte   `json:"leaf_hash"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// writeFile writes b to <dir>/<relPath>, creating parent directories as
+// needed.
+func writeFile(dir, relPath string, b []byte) error {
+	full := filepath.Join(dir, relPath)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", relPath, err)
+	}
+	if err := ioutil.WriteFile(full, b, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", relPath, err)
+	}
+	return nil
+}
+
+// sha256File returns the hex-encoded SHA-256 of the file at path.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// buildManifest walks every regular file under dir (skipping manifest.json
+// itself) and hashes it. Every other file under dir is hashed, including a
+// tarball written inside dir.
+func buildManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Files: map[string]string{}}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == manifestName {
+			return nil
+		}
+		sum, err := sha256File(path)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %v", rel, err)
+		}
+		m.Files[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk bundle directory: %v", err)
+	}
+	return m, nil
+}
+
+// writeManifest hashes every file under dir and writes the result as
+// <dir>/manifest.json.
+func writeManifest(dir string) error {
+	m, err := buildManifest(dir)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	return writeFile(dir, manifestName, b)
+}
+
+// readManifest reads <dir>/manifest.json.
+func readManifest(dir string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathHelpersEscapeLogID(t *testing.T) {
+	const logID = "some/log+id="
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"sthPath", sthPath(logID), filepath.Join("logs", "some%2Flog+id=", "sth.json")},
+		{"entryPath", entryPath(logID, 7), filepath.Join("logs", "some%2Flog+id=", "entries", "7.der")},
+		{"proofPath", proofPath(logID, 7), filepath.Join("logs", "some%2Flog+id=", "proofs", "7.json")},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s(%q) = %q, want %q", test.name, logID, test.got, test.want)
+		}
+	}
+}
+
+func TestWriteReadManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := writeFile(dir, "logs/log-a/sth.json", []byte(`{"tree_size":1}`)); err != nil {
+		t.Fatalf("writeFile(sth.json): %v", err)
+	}
+	if err := writeFile(dir, "logs/log-a/entries/0.der", []byte{0x01, 0x02, 0x03}); err != nil {
+		t.Fatalf("writeFile(0.der): %v", err)
+	}
+
+	if err := writeManifest(dir); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("manifest has %d files, want 2: %+v", len(m.Files), m.Files)
+	}
+
+	for rel, wantSum := range m.Files {
+		gotSum, err := sha256File(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("sha256File(%s): %v", rel, err)
+		}
+		if gotSum != wantSum {
+			t.Errorf("recomputed hash for %s = %s, want %s (matches manifest)", rel, gotSum, wantSum)
+		}
+	}
+}
+
+func TestBuildManifestDetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFile(dir, "logs/log-a/sth.json", []byte(`{"tree_size":1}`)); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	if err := writeManifest(dir); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+
+	if err := writeFile(dir, "logs/log-a/sth.json", []byte(`{"tree_size":2}`)); err != nil {
+		t.Fatalf("writeFile (tamper): %v", err)
+	}
+	got, err := sha256File(filepath.Join(dir, "logs", "log-a", "sth.json"))
+	if err != nil {
+		t.Fatalf("sha256File: %v", err)
+	}
+	if got == m.Files["logs/log-a/sth.json"] {
+		t.Fatalf("hash unchanged after tampering with file contents")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/internal/witness/feed"
+	"github.com/google/certificate-transparency-go/loglist2"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// runCollect implements the "collect" subcommand: it fetches a range of
+// entries for a log already pinned by "snapshot", along with an inclusion
+// proof for each against the pinned STH.
+func runCollect(args []string) error {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory containing the bundle-in-progress (from snapshot)")
+	logID := fs.String("log_id", "", "The log ID (as pinned by snapshot) to collect entries from")
+	start := fs.Uint64("start", 0, "First leaf index to collect (inclusive)")
+	end := fs.Uint64("end", 0, "Last leaf index to collect (exclusive)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" || *logID == "" || *end <= *start {
+		return fmt.Errorf("-dir and -log_id are required, and -end must be greater than -start")
+	}
+	ctx := context.Background()
+
+	c, sth, err := pinnedLogClient(*dir, *logID)
+	if err != nil {
+		return err
+	}
+	if *end > sth.TreeSize {
+		return fmt.Errorf("-end (%d) is beyond the pinned STH size (%d); run snapshot again first", *end, sth.TreeSize)
+	}
+
+	entries, err := c.GetEntries(ctx, int64(*start), int64(*end)-1)
+	if err != nil {
+		return fmt.Errorf("failed to fetch entries [%d, %d): %v", *start, *end, err)
+	}
+	for i := range entries {
+		e := &entries[i]
+		index := *start + uint64(i)
+
+		der := leafDER(e)
+		if err := writeFile(*dir, entryPath(*logID, index), der); err != nil {
+			return err
+		}
+
+		leafBytes, err := tls.Marshal(e.Leaf)
+		if err != nil {
+			return fmt.Errorf("failed to marshal leaf at index %d: %v", index, err)
+		}
+		leafHash := rfc6962.DefaultHasher.HashLeaf(leafBytes)
+		pf, err := c.GetProofByHash(ctx, leafHash, int64(sth.TreeSize))
+		if err != nil {
+			return fmt.Errorf("failed to fetch inclusion proof for index %d: %v", index, err)
+		}
+		proof := inclusionProof{LeafIndex: index, TreeSize: sth.TreeSize, LeafHash: leafHash, AuditPath: pf.AuditPath}
+		b, err := json.MarshalIndent(proof, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal inclusion proof for index %d: %v", index, err)
+		}
+		if err := writeFile(*dir, proofPath(*logID, index), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// leafDER returns the leaf certificate's raw DER, whether it came from an
+// X.509 chain or a precertificate.
+func leafDER(e *ct.LogEntry) []byte {
+	if e.X509Cert != nil {
+		return e.X509Cert.Raw
+	}
+	if e.Precert != nil {
+		return e.Precert.Submitted.Data
+	}
+	return nil
+}
+
+// pinnedLogClient reconstructs a log client for logID from the log list
+// pinned under dir by "snapshot", and returns the STH pinned alongside it.
+func pinnedLogClient(dir, logID string) (*client.LogClient, *ct.SignedTreeHead, error) {
+	listBody, err := ioutil.ReadFile(filepath.Join(dir, "metadata", "log_list.json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read pinned log list (run snapshot first): %v", err)
+	}
+	ll, err := loglist2.NewFromJSON(listBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse pinned log list: %v", err)
+	}
+	for _, operator := range ll.Operators {
+		for _, log := range operator.Logs {
+			if base64.StdEncoding.EncodeToString(log.LogID) != logID {
+				continue
+			}
+			c, err := feed.CreateLogClient(log.Key, log.URL)
+			if err != nil {
+				return nil, nil, err
+			}
+			sthBody, err := ioutil.ReadFile(filepath.Join(dir, sthPath(logID)))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read pinned STH (run snapshot first): %v", err)
+			}
+			var sthResp ct.GetSTHResponse
+			if err := json.Unmarshal(sthBody, &sthResp); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse pinned STH: %v", err)
+			}
+			sth, err := sthResp.ToSignedTreeHead()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to build STH from pinned response: %v", err)
+			}
+			return c, sth, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("log %q not found in pinned log list", logID)
+}
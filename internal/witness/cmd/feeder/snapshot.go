@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/internal/witness/feed"
+)
+
+// runSnapshot implements the "snapshot" subcommand: it pins the current
+// log list (and its signature) and the latest STH of every usable log
+// under dir, as the starting point for an evidence bundle.
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory to write the bundle-in-progress to")
+	logListURL := fs.String("log_list_url", "https://www.gstatic.com/ct/log_list/v3/log_list.json", "The location of the log list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("-dir is required")
+	}
+	ctx := context.Background()
+
+	listBody, err := fetchURL(*logListURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch log list: %v", err)
+	}
+	if err := writeFile(*dir, "metadata/log_list.json", listBody); err != nil {
+		return err
+	}
+	if sigBody, err := fetchURL(*logListURL + ".sig"); err != nil {
+		glog.Warningf("No log list signature fetched from %s.sig: %v", *logListURL, err)
+	} else if err := writeFile(*dir, "metadata/log_list.json.sig", sigBody); err != nil {
+		return err
+	}
+
+	logs, err := feed.PopulateLogs(*logListURL)
+	if err != nil {
+		return fmt.Errorf("failed to set up log data: %v", err)
+	}
+	for _, l := range logs {
+		var sthResp ct.GetSTHResponse
+		_, raw, err := l.Client.GetAndParse(ctx, ct.GetSTHPath, nil, &sthResp)
+		if err != nil {
+			glog.Errorf("Failed to fetch STH for %s: %v", l.Name, err)
+			continue
+		}
+		if err := writeFile(*dir, sthPath(l.ID), raw); err != nil {
+			return err
+		}
+		glog.Infof("Pinned STH for %s at size %d", l.Name, sthResp.TreeSize)
+	}
+	return nil
+}
+
+// fetchURL retrieves and returns the body of a GET request to url.
+func fetchURL(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: status %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
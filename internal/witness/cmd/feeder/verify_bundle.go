@@ -0,0 +1,282 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/ctutil"
+	"github.com/google/certificate-transparency-go/loglist2"
+	"github.com/google/certificate-transparency-go/merkletree"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// runVerifyBundle re-verifies an evidence bundle produced by
+// snapshot/collect/assemble: the manifest's file hashes, the log list
+// signature (if a public key is supplied), every pinned STH's signature,
+// and every collected entry's inclusion proof against its log's pinned
+// STH.
+func runVerifyBundle(dir, logListPubKeyPath string) error {
+	if fi, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("failed to stat bundle: %v", err)
+	} else if !fi.IsDir() {
+		tmp, err := ioutil.TempDir("", "ctfeeder-verify-")
+		if err != nil {
+			return fmt.Errorf("failed to create temp directory: %v", err)
+		}
+		defer os.RemoveAll(tmp)
+		if err := untar(dir, tmp); err != nil {
+			return fmt.Errorf("failed to unpack bundle: %v", err)
+		}
+		dir = tmp
+	}
+
+	if err := verifyManifest(dir); err != nil {
+		return err
+	}
+	glog.Info("Manifest hashes verified")
+
+	if logListPubKeyPath != "" {
+		if err := verifyLogListSignature(dir, logListPubKeyPath); err != nil {
+			return err
+		}
+		glog.Info("Log list signature verified")
+	}
+
+	listBody, err := ioutil.ReadFile(filepath.Join(dir, "metadata", "log_list.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read pinned log list: %v", err)
+	}
+	ll, err := loglist2.NewFromJSON(listBody)
+	if err != nil {
+		return fmt.Errorf("failed to parse pinned log list: %v", err)
+	}
+	keysByID := map[string][]byte{}
+	for _, operator := range ll.Operators {
+		for _, log := range operator.Logs {
+			keysByID[base64.StdEncoding.EncodeToString(log.LogID)] = log.Key
+		}
+	}
+
+	logsDir := filepath.Join(dir, "logs")
+	logIDs, err := ioutil.ReadDir(logsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list logs in bundle: %v", err)
+	}
+	for _, logDirEntry := range logIDs {
+		logID, err := url.PathUnescape(logDirEntry.Name())
+		if err != nil {
+			return fmt.Errorf("failed to unescape log directory name %q: %v", logDirEntry.Name(), err)
+		}
+		if err := verifyBundleLog(dir, logID, keysByID[logID]); err != nil {
+			return fmt.Errorf("log %s: %v", logID, err)
+		}
+		glog.Infof("Verified all collected entries for log %s", logID)
+	}
+	return nil
+}
+
+// verifyManifest recomputes the SHA-256 of every file recorded in the
+// bundle's manifest and checks it matches.
+func verifyManifest(dir string) error {
+	want, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	for rel, wantSum := range want.Files {
+		got, err := sha256File(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %v", rel, err)
+		}
+		if got != wantSum {
+			return fmt.Errorf("manifest mismatch for %s: got %s, want %s", rel, got, wantSum)
+		}
+	}
+	return nil
+}
+
+// verifyLogListSignature checks metadata/log_list.json.sig is a valid
+// Ed25519 signature over metadata/log_list.json, by the key in
+// logListPubKeyPath (a PEM-encoded PKIX public key).
+func verifyLogListSignature(dir, logListPubKeyPath string) error {
+	pemBytes, err := ioutil.ReadFile(logListPubKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read log list public key: %v", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return fmt.Errorf("failed to decode log list public key PEM")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse log list public key: %v", err)
+	}
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("log list public key is not Ed25519")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "metadata", "log_list.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read pinned log list: %v", err)
+	}
+	sig, err := ioutil.ReadFile(filepath.Join(dir, "metadata", "log_list.json.sig"))
+	if err != nil {
+		return fmt.Errorf("failed to read pinned log list signature: %v", err)
+	}
+	if !ed25519.Verify(edPub, data, sig) {
+		return fmt.Errorf("log list signature does not verify")
+	}
+	return nil
+}
+
+// verifyBundleLog re-verifies the pinned STH signature for logID, and
+// every collected entry's inclusion proof against it.
+func verifyBundleLog(dir, logID string, pubKeyDER []byte) error {
+	sthBody, err := ioutil.ReadFile(filepath.Join(dir, sthPath(logID)))
+	if err != nil {
+		return fmt.Errorf("failed to read pinned STH: %v", err)
+	}
+	var sthResp ct.GetSTHResponse
+	if err := json.Unmarshal(sthBody, &sthResp); err != nil {
+		return fmt.Errorf("failed to parse pinned STH: %v", err)
+	}
+	sth, err := sthResp.ToSignedTreeHead()
+	if err != nil {
+		return fmt.Errorf("failed to build STH from pinned response: %v", err)
+	}
+
+	if len(pubKeyDER) == 0 {
+		return fmt.Errorf("no public key for log in pinned log list")
+	}
+	pubKey, err := x509.ParsePKIXPublicKey(pubKeyDER)
+	if err != nil {
+		return fmt.Errorf("failed to parse log public key: %v", err)
+	}
+	if err := ctutil.VerifySTHSignature(pubKey, sth); err != nil {
+		return fmt.Errorf("STH signature does not verify: %v", err)
+	}
+
+	proofsDir := filepath.Join(dir, "logs", url.PathEscape(logID), "proofs")
+	proofFiles, err := ioutil.ReadDir(proofsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list proofs: %v", err)
+	}
+	verifier := merkletree.NewMerkleVerifier(rfc6962.DefaultHasher.HashChildren)
+	for _, pf := range proofFiles {
+		if !strings.HasSuffix(pf.Name(), ".json") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(proofsDir, pf.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", pf.Name(), err)
+		}
+		var proof inclusionProof
+		if err := json.Unmarshal(b, &proof); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", pf.Name(), err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, entryPath(logID, proof.LeafIndex))); err != nil {
+			return fmt.Errorf("missing entry for index %d: %v", proof.LeafIndex, err)
+		}
+		if err := verifier.VerifyInclusionProof(int64(proof.LeafIndex), int64(proof.TreeSize), proof.AuditPath, sth.SHA256RootHash[:], proof.LeafHash); err != nil {
+			return fmt.Errorf("inclusion proof for index %d does not verify: %v", proof.LeafIndex, err)
+		}
+	}
+	return nil
+}
+
+// safeJoin joins dstDir with a tar entry's name and checks the result is
+// still inside dstDir, rejecting the "../" and absolute-path tricks a
+// crafted tarball can use to write outside the extraction directory
+// (a bundle is untrusted input: it may have been shared with a third
+// party for offline verification and tampered with in transit).
+func safeJoin(dstDir, name string) (string, error) {
+	target := filepath.Join(dstDir, name)
+	rel, err := filepath.Rel(dstDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes extraction directory", name)
+	}
+	return target, nil
+}
+
+// untar extracts the gzipped tarball at srcPath into dstDir.
+func untar(srcPath, dstDir string) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeDir && hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("refusing to extract %s: unsupported entry type %d", hdr.Name, hdr.Typeflag)
+		}
+		target, err := safeJoin(dstDir, hdr.Name)
+		if err != nil {
+			return fmt.Errorf("refusing to extract %s: %v", hdr.Name, err)
+		}
+		if hdr.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		out.Close()
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package feed implements the core of the feeder: polling a CT log,
+// pushing each new STH to a set of witnesses, and aggregating their
+// cosignatures into a quorum-verified tree head. It's shared by the
+// feeder binary itself and by any other tool (e.g. ctmonitor) that needs
+// to react to a log's witnessed size advancing, rather than to the log's
+// own (unwitnessed) self-reported STH.
+package feed
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/internal/witness/archive"
+	wh "github.com/google/certificate-transparency-go/internal/witness/client/http"
+	"github.com/google/certificate-transparency-go/jsonclient"
+	"github.com/google/certificate-transparency-go/loglist2"
+)
+
+// WitnessURLList is a flag.Value that collects repeated -witness_url flags
+// into a slice.
+type WitnessURLList []string
+
+// String implements flag.Value.
+func (w *WitnessURLList) String() string {
+	return fmt.Sprint([]string(*w))
+}
+
+// Set implements flag.Value.
+func (w *WitnessURLList) Set(v string) error {
+	*w = append(*w, v)
+	return nil
+}
+
+// CosignedSTH bundles a single log's tree head together with the witness
+// cosignatures collected for it. Signatures are keyed by witness URL, which
+// stands in for the witness's key ID until wh.Witness.Update exposes one
+// directly.
+type CosignedSTH struct {
+	STH        *ct.SignedTreeHead `json:"sth"`
+	Signatures map[string][]byte  `json:"signatures"`
+}
+
+// quorumReached reports whether at least k distinct witnesses have
+// cosigned this STH.
+func (c *CosignedSTH) quorumReached(k int) bool {
+	return c != nil && c.STH != nil && len(c.Signatures) >= k
+}
+
+// Log contains the latest witnessed STH for a log and a log client.
+type Log struct {
+	ID     string
+	Name   string
+	Client *client.LogClient
+	health health
+
+	mu          sync.Mutex
+	wsth        *ct.SignedTreeHead
+	cosigned    *CosignedSTH
+	lastLogSize uint64
+}
+
+// PopulateLogs populates a list of Logs based on the log list.
+func PopulateLogs(logListURL string) ([]*Log, error) {
+	resp, err := http.Get(logListURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve log list: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP response: %v", err)
+	}
+	// Get data for all usable logs.
+	logList, err := loglist2.NewFromJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	usable := logList.SelectByStatus([]loglist2.LogStatus{loglist2.UsableLogStatus})
+	var logs []*Log
+	for _, operator := range usable.Operators {
+		for _, log := range operator.Logs {
+			logID := base64.StdEncoding.EncodeToString(log.LogID)
+			c, err := CreateLogClient(log.Key, log.URL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create log client: %v", err)
+			}
+			logs = append(logs, &Log{ID: logID, Name: log.Description, Client: c})
+		}
+	}
+	return logs, nil
+}
+
+// CreateLogClient creates a CT log client from a public key and URL.
+func CreateLogClient(key []byte, url string) (*client.LogClient, error) {
+	pemPK := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: key,
+	})
+	opts := jsonclient.Options{PublicKey: string(pemPK)}
+	c, err := client.New(url, http.DefaultClient, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JSON client: %v", err)
+	}
+	return c, nil
+}
+
+// LoadQuorumPolicy reads a JSON file mapping log ID to a quorum_k
+// override. An empty path is not an error; it simply yields no
+// overrides.
+func LoadQuorumPolicy(path string) (map[string]int, error) {
+	policy := map[string]int{}
+	if path == "" {
+		return policy, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quorum policy file: %v", err)
+	}
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse quorum policy file: %v", err)
+	}
+	return policy, nil
+}
+
+// Opts configures a call to Log.Feed.
+type Opts struct {
+	// Interval is how often to attempt a feedOnce round, absent backoff.
+	Interval time.Duration
+	// QuorumK is the minimum number of distinct witnesses that must
+	// cosign an STH before the feeder advances its local state.
+	QuorumK int
+	// StateDir, if non-empty, durably archives every witnessed STH (see
+	// package archive).
+	StateDir string
+	// OnAdvance, if set, is called synchronously after the witnessed size
+	// for this log advances from prevSize to sth.TreeSize, before feedOnce
+	// returns. Consumers that need to react to new, quorum-verified
+	// entries (rather than re-polling the log's own unwitnessed STH)
+	// should hook this instead of watching the log directly. An error it
+	// returns is treated the same as any other feedOnce failure: Feed
+	// backs off before its next attempt.
+	OnAdvance func(logID, name string, prevSize uint64, sth *ct.SignedTreeHead) error
+}
+
+// latestSize returns the size of the latest quorum-signed STH.
+func (l *Log) latestSize() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.wsth != nil {
+		return l.wsth.TreeSize
+	}
+	return 0
+}
+
+// LatestCosigned returns the latest quorum-signed STH bundled with its
+// witness cosignatures, or nil if none has been collected yet.
+func (l *Log) LatestCosigned() *CosignedSTH {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cosigned
+}
+
+// SeedFromArchive initializes l's witnessed state from the latest entry in
+// the archive under stateDir, if one exists, instead of starting at size
+// zero.
+func (l *Log) SeedFromArchive(stateDir string) error {
+	sth, _, err := archive.Latest(stateDir, l.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load archived state for %s: %v", l.Name, err)
+	}
+	if sth != nil {
+		glog.Infof("Resuming %s from archived size %d", l.Name, sth.TreeSize)
+		l.mu.Lock()
+		l.wsth = sth
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// Feed feeds continuously for a given log, returning only when the context
+// is done. Instead of polling at a fixed rate, it tracks consecutive
+// feedOnce failures (including a witness reporting wh.ErrSTHTooOld) in
+// l.health and backs off exponentially, with jitter, between attempts.
+func (l *Log) Feed(ctx context.Context, witnesses []*wh.Witness, opts Opts) error {
+	for {
+		var wait time.Duration
+		func() {
+			wSize := l.latestSize()
+			ctx, cancel := context.WithTimeout(ctx, opts.Interval)
+			defer cancel()
+
+			glog.V(2).Infof("Start feedOnce for %s (witness size %d)", l.Name, wSize)
+			start := time.Now()
+			err := l.feedOnce(ctx, witnesses, opts)
+			metricFeedLatency.WithLabelValues(l.ID).Observe(time.Since(start).Seconds())
+			if err != nil {
+				metricFeedFailures.WithLabelValues(l.ID).Inc()
+				glog.Warningf("Failed to feed for %s: %v", l.Name, err)
+			}
+			wait = l.health.record(opts.Interval, err)
+			glog.V(2).Infof("feedOnce complete for %s (witness size %d, next attempt in %s)", l.Name, wSize, wait)
+		}()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// sthKey returns a key identifying the (tree_size, root_hash, timestamp)
+// triple of an STH, for grouping cosignatures on matching tree heads.
+func sthKey(sth *ct.SignedTreeHead) string {
+	return fmt.Sprintf("%d-%x-%d", sth.TreeSize, sth.SHA256RootHash, sth.Timestamp)
+}
+
+// errNoWitnessResponded is returned by feedOnce when every witness in the
+// fan-out failed, as distinct from a quorum simply not having been reached
+// yet among witnesses that did respond.
+var errNoWitnessResponded = errors.New("no witness responded successfully")
+
+// feedOnce attempts to push the latest STH from the log to every configured
+// witness in parallel, and advances the local state to the STH cosigned by
+// the most witnesses, provided at least opts.QuorumK distinct witnesses have
+// cosigned it.
+func (l *Log) feedOnce(ctx context.Context, witnesses []*wh.Witness, opts Opts) error {
+	// Get and parse the latest STH from the log.
+	var sthResp ct.GetSTHResponse
+	_, csthRaw, err := l.Client.GetAndParse(ctx, ct.GetSTHPath, nil, &sthResp)
+	if err != nil {
+		return fmt.Errorf("failed to get latest STH: %v", err)
+	}
+	csth, err := sthResp.ToSignedTreeHead()
+	if err != nil {
+		return fmt.Errorf("failed to parse response as STH: %v", err)
+	}
+	metricLogSize.WithLabelValues(l.ID).Set(float64(csth.TreeSize))
+	l.mu.Lock()
+	l.lastLogSize = csth.TreeSize
+	l.mu.Unlock()
+
+	wSize := l.latestSize()
+	if wSize >= csth.TreeSize {
+		glog.V(1).Infof("Witness size %d >= log size %d for %s - nothing to do", wSize, csth.TreeSize, l.Name)
+		return nil
+	}
+
+	glog.Infof("Updating %d witnesses from size %d to %d for %s", len(witnesses), wSize, csth.TreeSize, l.Name)
+	// If we want to update the witnesses then let's get a consistency proof.
+	var pf [][]byte
+	if wSize > 0 {
+		pf, err = l.Client.GetSTHConsistency(ctx, wSize, csth.TreeSize)
+		if err != nil {
+			return fmt.Errorf("failed to get consistency proof: %v", err)
+		}
+	}
+
+	// Push the new STH and consistency proof to every witness in parallel,
+	// collecting each one's (possibly cosigned) response.
+	type result struct {
+		witnessID string
+		wsth      *ct.SignedTreeHead
+		raw       []byte
+		tooOld    bool
+		err       error
+	}
+	results := make([]result, len(witnesses))
+	var wg sync.WaitGroup
+	for i, w := range witnesses {
+		wg.Add(1)
+		go func(i int, w *wh.Witness) {
+			defer wg.Done()
+			witnessID := w.URL.String()
+			wsthRaw, err := w.Update(ctx, l.ID, csthRaw, pf)
+			tooOld := errors.Is(err, wh.ErrSTHTooOld)
+			if err != nil && !tooOld {
+				results[i] = result{witnessID: witnessID, err: fmt.Errorf("failed to update STH: %v", err)}
+				return
+			}
+			var wsthJSON ct.GetSTHResponse
+			if err := json.Unmarshal(wsthRaw, &wsthJSON); err != nil {
+				results[i] = result{witnessID: witnessID, err: fmt.Errorf("failed to unmarshal json: %v", err)}
+				return
+			}
+			wsth, err := wsthJSON.ToSignedTreeHead()
+			if err != nil {
+				results[i] = result{witnessID: witnessID, err: fmt.Errorf("failed to create STH: %v", err)}
+				return
+			}
+			results[i] = result{witnessID: witnessID, wsth: wsth, raw: wsthRaw, tooOld: tooOld}
+		}(i, w)
+	}
+	wg.Wait()
+
+	var sawTooOld bool
+	var sawSuccess bool
+
+	// Group the responses that agree on the same (tree_size, root_hash,
+	// timestamp) triple, and pick the one with the most cosignatures.
+	groups := map[string]*CosignedSTH{}
+	groupRaw := map[string][]byte{}
+	for _, r := range results {
+		if r.err != nil {
+			glog.Warningf("Witness %s failed to update for %s: %v", r.witnessID, l.Name, r.err)
+			continue
+		}
+		sawSuccess = true
+		if r.tooOld {
+			sawTooOld = true
+		}
+		key := sthKey(r.wsth)
+		g, ok := groups[key]
+		if !ok {
+			g = &CosignedSTH{STH: r.wsth, Signatures: map[string][]byte{}}
+			groups[key] = g
+			groupRaw[key] = r.raw
+		}
+		g.Signatures[r.witnessID] = r.wsth.Signature.Signature
+	}
+
+	if !sawSuccess {
+		// Every witness in the fan-out errored outright: this is an
+		// outage, not "quorum not met yet", and must count as a failed
+		// round so health/backoff (and -status_addr) reflect it.
+		return fmt.Errorf("%w (%d witnesses)", errNoWitnessResponded, len(witnesses))
+	}
+
+	var best *CosignedSTH
+	var bestKey string
+	for key, g := range groups {
+		if best == nil || len(g.Signatures) > len(best.Signatures) {
+			best = g
+			bestKey = key
+		}
+	}
+	if !best.quorumReached(opts.QuorumK) {
+		glog.V(1).Infof("Quorum of %d not yet reached for %s (best: %d cosignatures)", opts.QuorumK, l.Name, len(best.Signatures))
+		if sawTooOld {
+			return fmt.Errorf("quorum not reached and a witness reported %w", wh.ErrSTHTooOld)
+		}
+		return nil
+	}
+
+	if opts.StateDir != "" {
+		if err := archive.Append(opts.StateDir, l.ID, best.STH, groupRaw[bestKey], pf, wSize); err != nil {
+			glog.Errorf("Failed to archive STH for %s: %v", l.Name, err)
+		}
+	}
+
+	metricWitnessSize.WithLabelValues(l.ID).Set(float64(best.STH.TreeSize))
+	l.mu.Lock()
+	l.wsth = best.STH
+	l.cosigned = best
+	l.mu.Unlock()
+
+	if opts.OnAdvance != nil {
+		if err := opts.OnAdvance(l.ID, l.Name, wSize, best.STH); err != nil {
+			return fmt.Errorf("OnAdvance failed for %s: %v", l.Name, err)
+		}
+	}
+
+	if sawTooOld {
+		// A witness is behind the others; treat this round as degraded so
+		// Feed backs off, even though we made progress overall.
+		return fmt.Errorf("a witness reported %w", wh.ErrSTHTooOld)
+	}
+	return nil
+}
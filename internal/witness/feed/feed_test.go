@@ -0,0 +1,66 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func sth(size uint64, root byte, ts uint64) *ct.SignedTreeHead {
+	s := &ct.SignedTreeHead{TreeSize: size, Timestamp: ts}
+	s.SHA256RootHash[0] = root
+	return s
+}
+
+func TestQuorumReached(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *CosignedSTH
+		k    int
+		want bool
+	}{
+		{"nil cosigned", nil, 1, false},
+		{"nil STH", &CosignedSTH{Signatures: map[string][]byte{"a": {1}}}, 1, false},
+		{"below quorum", &CosignedSTH{STH: sth(10, 1, 1), Signatures: map[string][]byte{"a": {1}}}, 2, false},
+		{"meets quorum", &CosignedSTH{STH: sth(10, 1, 1), Signatures: map[string][]byte{"a": {1}, "b": {2}}}, 2, true},
+		{"exceeds quorum", &CosignedSTH{STH: sth(10, 1, 1), Signatures: map[string][]byte{"a": {1}, "b": {2}, "c": {3}}}, 2, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.c.quorumReached(test.k); got != test.want {
+				t.Errorf("quorumReached(%d) = %v, want %v", test.k, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSTHKeyGroupsOnlyIdenticalSTHs(t *testing.T) {
+	base := sth(100, 0xAB, 12345)
+	sameAgain := sth(100, 0xAB, 12345)
+	diffSize := sth(101, 0xAB, 12345)
+	diffRoot := sth(100, 0xCD, 12345)
+	diffTime := sth(100, 0xAB, 99999)
+
+	if sthKey(base) != sthKey(sameAgain) {
+		t.Errorf("sthKey differs for identical STHs: %q vs %q", sthKey(base), sthKey(sameAgain))
+	}
+	for _, other := range []*ct.SignedTreeHead{diffSize, diffRoot, diffTime} {
+		if sthKey(base) == sthKey(other) {
+			t.Errorf("sthKey(%+v) unexpectedly equal to sthKey(%+v)", base, other)
+		}
+	}
+}
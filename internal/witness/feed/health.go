@@ -0,0 +1,188 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricWitnessSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ctfeeder_witness_size",
+		Help: "Size of the latest quorum-signed STH held by the feeder, by log ID",
+	}, []string{"log_id"})
+	metricLogSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ctfeeder_log_size",
+		Help: "Size of the latest STH fetched from the log, by log ID",
+	}, []string{"log_id"})
+	metricFeedFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ctfeeder_feed_failures_total",
+		Help: "Number of failed feedOnce attempts, by log ID",
+	}, []string{"log_id"})
+	metricFeedLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ctfeeder_feed_latency_seconds",
+		Help: "Latency of feedOnce attempts, by log ID",
+	}, []string{"log_id"})
+)
+
+// health tracks the outcome of recent feedOnce attempts for a single log,
+// so Feed can back off when it's failing and report its state over
+// ServeStatus.
+type health struct {
+	mu sync.Mutex
+
+	failures    int
+	lastErr     error
+	lastSuccess time.Time
+	nextAttempt time.Time
+}
+
+// record updates health after a feedOnce attempt that returned err (nil on
+// success), and returns how long to wait before the next attempt.
+func (h *health) record(baseInterval time.Duration, err error) time.Duration {
+	const maxBackoff = 10 * time.Minute
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.failures++
+		h.lastErr = err
+	} else {
+		h.failures = 0
+		h.lastErr = nil
+		h.lastSuccess = time.Now()
+	}
+
+	wait := baseInterval
+	if h.failures > 0 {
+		wait = baseInterval << uint(h.failures-1)
+		if wait > maxBackoff || wait <= 0 {
+			wait = maxBackoff
+		}
+	}
+	wait = jitter(wait)
+	h.nextAttempt = time.Now().Add(wait)
+	return wait
+}
+
+// jitter returns a random duration in [d/2, d], so that many logs backing
+// off at the same rate don't all retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half+1)))
+}
+
+// Status is the JSON representation of a single log's feed health, served
+// by ServeStatus.
+type Status struct {
+	LogID         string    `json:"logID"`
+	Name          string    `json:"name"`
+	WitnessedSize uint64    `json:"witnessedSize"`
+	LastLogSize   uint64    `json:"lastLogSize"`
+	LastSuccess   time.Time `json:"lastSuccess"`
+	LastError     string    `json:"lastError,omitempty"`
+	NextAttempt   time.Time `json:"nextAttempt"`
+}
+
+// status returns a snapshot of l's current feed health.
+func (l *Log) status() Status {
+	l.mu.Lock()
+	witnessedSize := uint64(0)
+	if l.wsth != nil {
+		witnessedSize = l.wsth.TreeSize
+	}
+	lastLogSize := l.lastLogSize
+	l.mu.Unlock()
+
+	l.health.mu.Lock()
+	defer l.health.mu.Unlock()
+	s := Status{
+		LogID:         l.ID,
+		Name:          l.Name,
+		WitnessedSize: witnessedSize,
+		LastLogSize:   lastLogSize,
+		LastSuccess:   l.health.lastSuccess,
+		NextAttempt:   l.health.nextAttempt,
+	}
+	if l.health.lastErr != nil {
+		s.LastError = l.health.lastErr.Error()
+	}
+	return s
+}
+
+// ServeStatus serves a JSON array of every log's feed health at "/status",
+// and Prometheus metrics at "/metrics".
+func ServeStatus(addr string, logs []*Log) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		out := make([]Status, 0, len(logs))
+		for _, l := range logs {
+			out = append(out, l.status())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(out); err != nil {
+			glog.Errorf("Failed to encode status: %v", err)
+		}
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	glog.Infof("Serving status on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		glog.Errorf("status server exited: %v", err)
+	}
+}
+
+// ServeCosignedSTHs serves the latest quorum-signed STH for each log over
+// HTTP, keyed by the "log_id" query parameter.
+func ServeCosignedSTHs(addr string, logs []*Log) {
+	byID := make(map[string]*Log, len(logs))
+	for _, l := range logs {
+		byID[l.ID] = l
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosigned-sth", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("log_id")
+		l, ok := byID[id]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown log_id %q", id), http.StatusNotFound)
+			return
+		}
+		cosigned := l.LatestCosigned()
+		if cosigned == nil {
+			http.Error(w, "no quorum-signed STH yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cosigned); err != nil {
+			glog.Errorf("Failed to encode cosigned STH for %s: %v", id, err)
+		}
+	})
+	glog.Infof("Serving cosigned STHs on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		glog.Errorf("cosigned STH server exited: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthRecordBacksOffExponentiallyOnFailure(t *testing.T) {
+	const base = 10 * time.Second
+	h := &health{}
+
+	// Each consecutive failure should at least double the minimum
+	// possible wait (jitter returns [d/2, d]), up to the 10-minute cap.
+	prevMin := time.Duration(0)
+	for i := 1; i <= 8; i++ {
+		wait := h.record(base, errors.New("boom"))
+		wantBase := base << uint(i-1)
+		if wantBase > 10*time.Minute {
+			wantBase = 10 * time.Minute
+		}
+		if min, max := wantBase/2, wantBase; wait < min || wait > max {
+			t.Fatalf("failure %d: wait = %v, want in [%v, %v]", i, wait, min, max)
+		}
+		if i > 1 && wait < prevMin {
+			t.Fatalf("failure %d: wait %v went below previous floor %v; backoff should not shrink", i, wait, prevMin)
+		}
+		prevMin = wantBase / 2
+	}
+
+	if got := h.failures; got != 8 {
+		t.Errorf("failures = %d, want 8", got)
+	}
+}
+
+func TestHealthRecordResetsOnSuccess(t *testing.T) {
+	const base = 10 * time.Second
+	h := &health{}
+
+	h.record(base, errors.New("boom"))
+	h.record(base, errors.New("boom"))
+	if h.failures != 2 {
+		t.Fatalf("failures = %d, want 2 before recovery", h.failures)
+	}
+
+	wait := h.record(base, nil)
+	if h.failures != 0 {
+		t.Errorf("failures = %d after success, want 0", h.failures)
+	}
+	if h.lastErr != nil {
+		t.Errorf("lastErr = %v after success, want nil", h.lastErr)
+	}
+	if wait < base/2 || wait > base {
+		t.Errorf("wait after recovery = %v, want in [%v, %v] (base interval, no backoff)", wait, base/2, base)
+	}
+}
+
+func TestHealthRecordCapsBackoffAtMaxBackoff(t *testing.T) {
+	const base = time.Minute
+	const maxBackoff = 10 * time.Minute
+	h := &health{}
+
+	var wait time.Duration
+	for i := 0; i < 20; i++ {
+		wait = h.record(base, errors.New("boom"))
+	}
+	if wait > maxBackoff {
+		t.Errorf("wait after many failures = %v, want capped at %v", wait, maxBackoff)
+	}
+}
+
+func TestJitterStaysInRange(t *testing.T) {
+	d := 100 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		got := jitter(d)
+		if got < d/2 || got > d {
+			t.Fatalf("jitter(%v) = %v, want in [%v, %v]", d, got, d/2, d)
+		}
+	}
+}
+
+func TestJitterZeroIsZero(t *testing.T) {
+	if got := jitter(0); got != 0 {
+		t.Errorf("jitter(0) = %v, want 0", got)
+	}
+}